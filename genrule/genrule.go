@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/google/blueprint"
+	"github.com/google/blueprint/proptools"
 
 	"android/soong/android"
 )
@@ -26,6 +27,17 @@ import (
 func init() {
 	android.RegisterModuleType("gensrcs", GenSrcsFactory)
 	android.RegisterModuleType("genrule", GenRuleFactory)
+	android.RegisterModuleType("genrule_defaults", DefaultsFactory)
+
+	// defaults must be resolved before the Deps phase runs generator.DepsMutator, or a tool,
+	// tool_file, or :module src supplied only through a genrule_defaults would still be absent
+	// from g.properties when DepsMutator reads it, and would never get a dependency edge.
+	android.PreArchMutators(func(ctx android.RegisterMutatorsContext) {
+		ctx.BottomUp("genrule_defaults_deps", defaultsDepsMutator)
+		ctx.TopDown("genrule_defaults", defaultsMutator)
+	})
+
+	pctx.HostBinToolVariable("SboxCmd", "sbox")
 }
 
 var (
@@ -33,8 +45,18 @@ var (
 )
 
 type SourceFileGenerator interface {
+	// GeneratedSourceFiles returns the subset of this module's outputs that are source files
+	// to be compiled, excluding any output under an exported include dir.
 	GeneratedSourceFiles() android.Paths
-	GeneratedHeaderDir() android.Path
+
+	// GeneratedDeps returns every output of this module, source and header alike, so that a
+	// consumer can add them all as implicit dependencies.
+	GeneratedDeps() android.Paths
+
+	// GeneratedHeaderDirs returns the directories under this module's gen directory, if any,
+	// that its `export_include_dirs` declared; a consumer adds these to its include path
+	// instead of listing each generated header individually.
+	GeneratedHeaderDirs() android.Paths
 }
 
 type HostToolProvider interface {
@@ -44,10 +66,16 @@ type HostToolProvider interface {
 type generatorProperties struct {
 	// command to run on one or more input files.  Available variables for substitution:
 	// $(location): the path to the first entry in tools or tool_files
-	// $(location <label>): the path to the tool or tool_file with name <label>
+	// $(location <label>): the path to the tool, tool_file, or ":module" label with name <label>
+	// $(locations <label>): the paths to all outputs of the ":module" label with name <label>,
+	// space separated
 	// $(in): one or more input files
 	// $(out): a single output file
+	// $(outs): all output files for this invocation, space separated; only differs from
+	// $(out) when gensrcs produces more than one output per input (output_extensions)
 	// $(genDir): the sandbox directory for this tool; contains $(out)
+	// $(depfile): a file that will be read as a Ninja depfile after the rule runs, if
+	// `depfile` is set to true
 	// $$: a literal $
 	//
 	// DO NOT directly reference paths to files in the source tree, or the
@@ -59,8 +87,27 @@ type generatorProperties struct {
 	// prebuilts or scripts that do not need a module to build them.
 	Tools []string
 
-	// Local file that is used as the tool
+	// Local file that is used as the tool. If the path is a module reference it is
+	// resolved to that module's output or host tool path.
 	Tool_files []string
+
+	// if true, the command writes a Ninja depfile to $(depfile) that lists additional
+	// implicit inputs discovered while running, and `cmd` must reference $(depfile)
+	Depfile bool
+
+	// list of input files, a ":module" entry will take the outputs of "module" as inputs
+	Srcs []string
+
+	// list of genrule_defaults modules that provide default values for these properties; not
+	// itself transitive, so a genrule_defaults listed here may not in turn set its own `defaults`
+	Defaults []string
+
+	// if true, run `cmd` inside a sandbox that only exposes the declared tools, tool_files,
+	// and srcs, plus $(genDir); catches missing dependencies that would otherwise only show
+	// up as flaky incremental builds.  On a host where sbox cannot set up a mount namespace
+	// (not Linux, or no CAP_SYS_ADMIN), the command runs with the whole filesystem visible
+	// and missing dependencies are not caught there.
+	Sandboxed bool
 }
 
 type generator struct {
@@ -68,29 +115,53 @@ type generator struct {
 
 	properties generatorProperties
 
+	// extraProperties holds the genRuleProperties or genSrcsProperties specific to this
+	// module's factory, so that defaultsMutator can merge a genrule_defaults module's
+	// matching properties into it.
+	extraProperties interface{}
+
 	tasks taskFunc
 
-	deps android.Paths
-	rule blueprint.Rule
+	deps     android.Paths
+	toolDeps android.Paths
+	rule     blueprint.Rule
 
 	genPath android.Path
 
+	exportIncludeDirs android.Paths
+
 	outputFiles android.Paths
+	outputDeps  android.Paths
 }
 
-type taskFunc func(ctx android.ModuleContext) []generateTask
+type taskFunc func(ctx android.ModuleContext, g *generatorProperties, srcFiles android.Paths) ([]generateTask, android.Paths)
 
 type generateTask struct {
-	in  android.Paths
-	out android.WritablePaths
+	in      android.Paths
+	out     android.WritablePaths
+	depFile android.WritablePath
+
+	// isHeader[i] is true if out[i] falls under one of the module's export_include_dirs, and
+	// should be excluded from GeneratedSourceFiles() in favor of GeneratedHeaderDirs().
+	isHeader []bool
+
+	// multiOutput is true if this task's outputs come from a single gensrcs invocation that
+	// produced more than one file per input (output_extensions); only then does $(outs) need
+	// to diverge from $(out), so only then is it safe to declare outputs beyond the first as
+	// ImplicitOutputs rather than all as Outputs.
+	multiOutput bool
 }
 
 func (g *generator) GeneratedSourceFiles() android.Paths {
 	return g.outputFiles
 }
 
-func (g *generator) GeneratedHeaderDir() android.Path {
-	return g.genPath
+func (g *generator) GeneratedDeps() android.Paths {
+	return g.outputDeps
+}
+
+func (g *generator) GeneratedHeaderDirs() android.Paths {
+	return g.exportIncludeDirs
 }
 
 func (g *generator) DepsMutator(ctx android.BottomUpMutatorContext) {
@@ -100,6 +171,24 @@ func (g *generator) DepsMutator(ctx android.BottomUpMutatorContext) {
 				{"arch", ctx.AConfig().BuildOsVariant},
 			}, nil, g.properties.Tools...)
 		}
+
+		for _, tool := range g.properties.Tool_files {
+			if m := android.SrcIsModule(tool); m != "" {
+				ctx.AddFarVariationDependencies([]blueprint.Variation{
+					{"arch", ctx.AConfig().BuildOsVariant},
+				}, nil, m)
+			}
+		}
+
+		for _, src := range g.properties.Srcs {
+			if m := android.SrcIsModule(src); m != "" {
+				ctx.AddDependency(ctx.Module(), nil, m)
+			}
+		}
+
+		// defaults are resolved earlier, by defaultsDepsMutator/defaultsMutator in
+		// PreArchMutators, so that g.properties above already reflects any merged-in
+		// tools/tool_files/srcs by the time this DepsMutator runs.
 	}
 }
 
@@ -111,58 +200,130 @@ func (g *generator) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 
 	g.genPath = android.PathForModuleGen(ctx, "")
 
-	tools := map[string]android.Path{}
-
-	if len(g.properties.Tools) > 0 {
-		ctx.VisitDirectDeps(func(module blueprint.Module) {
-			if t, ok := module.(HostToolProvider); ok {
-				p := t.HostToolPath()
-				if p.Valid() {
-					g.deps = append(g.deps, p.Path())
-					tool := ctx.OtherModuleName(module)
-					if _, exists := tools[tool]; !exists {
-						tools[tool] = p.Path()
-					} else {
-						ctx.ModuleErrorf("multiple tools for %q, %q and %q", tool, tools[tool], p.Path().String())
-					}
-				} else {
-					ctx.ModuleErrorf("host tool %q missing output file", ctx.OtherModuleName(module))
-				}
+	locations := map[string]android.Paths{}
+	srcLabels := map[string]android.Paths{}
+
+	addLocation := func(label string, paths android.Paths) {
+		// a module that produced no output files at all resolves to zero paths here; refuse
+		// the label outright rather than let $(location)/$(locations) index into an empty list.
+		if len(paths) == 0 {
+			ctx.ModuleErrorf("%q produces no output files usable as a location", label)
+			return
+		}
+		if _, exists := locations[label]; !exists {
+			locations[label] = paths
+		} else {
+			ctx.ModuleErrorf("multiple tools for %q, %q and %q", label, locations[label], paths)
+		}
+	}
+
+	ctx.VisitDirectDeps(func(module blueprint.Module) {
+		if _, ok := module.(*GenRuleDefaults); ok {
+			return
+		}
+
+		name := ctx.OtherModuleName(module)
+
+		if label, ok := labelForModuleDep(g.properties.Srcs, name); ok {
+			t, ok := module.(SourceFileGenerator)
+			if !ok {
+				ctx.ModuleErrorf("module %q used as a source file label is not a source file generator", name)
+				return
+			}
+			// srcLabels only ever feeds the actual sources to process, so it stays source-only;
+			// but a location reference to this label should resolve even if the module's entire
+			// output is headers, so the location map gets every output it produced.
+			srcPaths := t.GeneratedSourceFiles()
+			allPaths := t.GeneratedDeps()
+			g.deps = append(g.deps, allPaths...)
+			srcLabels[label] = srcPaths
+			addLocation(label, allPaths)
+			return
+		}
+
+		if t, ok := module.(HostToolProvider); ok {
+			p := t.HostToolPath()
+			if !p.Valid() {
+				ctx.ModuleErrorf("host tool %q missing output file", name)
+				return
+			}
+			g.deps = append(g.deps, p.Path())
+			g.toolDeps = append(g.toolDeps, p.Path())
+			if label, ok := labelForModuleDep(g.properties.Tool_files, name); ok {
+				addLocation(label, android.Paths{p.Path()})
 			} else {
-				ctx.ModuleErrorf("unknown dependency %q", ctx.OtherModuleName(module))
+				addLocation(name, android.Paths{p.Path()})
 			}
-		})
-	}
+		} else if t, ok := module.(SourceFileGenerator); ok {
+			allPaths := t.GeneratedDeps()
+			g.deps = append(g.deps, allPaths...)
+			if label, ok := labelForModuleDep(g.properties.Tool_files, name); ok {
+				addLocation(label, allPaths)
+			} else {
+				ctx.ModuleErrorf("unknown dependency %q", name)
+			}
+		} else {
+			ctx.ModuleErrorf("unknown dependency %q", name)
+		}
+	})
 
 	for _, tool := range g.properties.Tool_files {
+		if android.SrcIsModule(tool) != "" {
+			continue
+		}
 		toolPath := android.PathForModuleSrc(ctx, tool)
 		g.deps = append(g.deps, toolPath)
-		if _, exists := tools[tool]; !exists {
-			tools[tool] = toolPath
+		g.toolDeps = append(g.toolDeps, toolPath)
+		addLocation(tool, android.Paths{toolPath})
+	}
+
+	srcFiles := make(android.Paths, 0, len(g.properties.Srcs))
+	for _, src := range g.properties.Srcs {
+		if android.SrcIsModule(src) != "" {
+			srcFiles = append(srcFiles, srcLabels[src]...)
 		} else {
-			ctx.ModuleErrorf("multiple tools for %q, %q and %q", tool, tools[tool], toolPath.String())
+			// a glob entry can expand to any number of files, so expand each entry on its own.
+			srcFiles = append(srcFiles, ctx.ExpandSources([]string{src}, nil)...)
 		}
 	}
 
+	hasDepfile := false
+
 	cmd, err := android.Expand(g.properties.Cmd, func(name string) (string, error) {
 		switch name {
 		case "location":
 			if len(g.properties.Tools) > 0 {
-				return tools[g.properties.Tools[0]].String(), nil
+				return locations[g.properties.Tools[0]][0].String(), nil
 			} else {
-				return tools[g.properties.Tool_files[0]].String(), nil
+				return locations[g.properties.Tool_files[0]][0].String(), nil
 			}
 		case "in":
 			return "${in}", nil
 		case "out":
 			return "${out}", nil
+		case "outs":
+			return "${outs}", nil
+		case "depfile":
+			if !g.properties.Depfile {
+				return "", fmt.Errorf("$(depfile) used without `depfile: true`")
+			}
+			hasDepfile = true
+			return "${depfile}", nil
 		case "genDir":
 			return g.genPath.String(), nil
 		default:
+			if strings.HasPrefix(name, "locations ") {
+				label := strings.TrimSpace(strings.TrimPrefix(name, "locations "))
+				if paths, ok := locations[label]; ok {
+					return strings.Join(paths.Strings(), " "), nil
+				} else {
+					return "", fmt.Errorf("unknown locations label %q", label)
+				}
+			}
 			if strings.HasPrefix(name, "location ") {
 				label := strings.TrimSpace(strings.TrimPrefix(name, "location "))
-				if tool, ok := tools[label]; ok {
-					return tool.String(), nil
+				if paths, ok := locations[label]; ok {
+					return paths[0].String(), nil
 				} else {
 					return "", fmt.Errorf("unknown location label %q", label)
 				}
@@ -175,25 +336,119 @@ func (g *generator) GenerateAndroidBuildActions(ctx android.ModuleContext) {
 		ctx.PropertyErrorf("cmd", "%s", err.Error())
 	}
 
-	g.rule = ctx.Rule(pctx, "generator", blueprint.RuleParams{
+	if g.properties.Depfile && !hasDepfile {
+		ctx.PropertyErrorf("cmd", "must contain '$(depfile)' since 'depfile' is true")
+	}
+
+	if g.properties.Sandboxed {
+		cmd = g.sandboxCommand(cmd, srcFiles)
+	}
+
+	rule := blueprint.RuleParams{
 		Command: cmd,
-	})
+	}
 
-	for _, task := range g.tasks(ctx) {
+	if g.properties.Depfile {
+		rule.Depfile = "${depfile}"
+		rule.Deps = blueprint.DepsGCC
+	}
+
+	if g.properties.Sandboxed {
+		rule.CommandDeps = append(rule.CommandDeps, "${SboxCmd}")
+	}
+
+	// $(outs) and $(depfile) expand to ${outs} and ${depfile}, which the rule must declare
+	// as arguments for each build statement to supply them.
+	args := []string{"outs"}
+	if g.properties.Depfile {
+		args = append(args, "depfile")
+	}
+	g.rule = ctx.Rule(pctx, "generator", rule, args...)
+
+	tasks, exportIncludeDirs := g.tasks(ctx, &g.properties, srcFiles)
+	g.exportIncludeDirs = exportIncludeDirs
+
+	for _, task := range tasks {
 		g.generateSourceFile(ctx, task)
 	}
 }
 
+// labelForModuleDep returns the ":module" label in list that refers to the module named name,
+// if any.
+func labelForModuleDep(list []string, name string) (string, bool) {
+	for _, entry := range list {
+		if android.SrcIsModule(entry) == name {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// sandboxCommand wraps cmd so that it runs under the sbox helper (see genrule/sbox), which
+// only exposes the module's declared tools, tool_files, srcs, and $(genDir) to the command.
+func (g *generator) sandboxCommand(cmd string, srcFiles android.Paths) string {
+	args := []string{
+		"${SboxCmd}",
+		"--sandbox-dir", g.genPath.String() + "/sbox",
+		"--output-root", g.genPath.String(),
+	}
+	for _, tool := range g.toolDeps {
+		args = append(args, "--tool", tool.String())
+	}
+	for _, dep := range g.deps {
+		args = append(args, "--input", dep.String())
+	}
+	for _, src := range srcFiles {
+		args = append(args, "--input", src.String())
+	}
+	args = append(args, "-c", proptools.ShellEscape(cmd))
+
+	return strings.Join(args, " ")
+}
+
 func (g *generator) generateSourceFile(ctx android.ModuleContext, task generateTask) {
-	ctx.ModuleBuild(pctx, android.ModuleBuildParams{
+	if len(task.out) == 0 {
+		ctx.ModuleErrorf("at least one output file is required")
+		return
+	}
+
+	outs := make([]string, 0, len(task.out))
+	for _, out := range task.out {
+		outs = append(outs, out.String())
+	}
+
+	params := android.ModuleBuildParams{
 		Rule:      g.rule,
-		Outputs:   task.out,
 		Inputs:    task.in,
 		Implicits: g.deps,
-	})
+		Args: map[string]string{
+			"outs": strings.Join(outs, " "),
+		},
+	}
 
-	for _, outputFile := range task.out {
-		g.outputFiles = append(g.outputFiles, outputFile)
+	if task.multiOutput && len(task.out) > 1 {
+		// only the first output is substituted into $(out); the rest are declared so Ninja
+		// tracks them, but must be referenced through $(outs) instead.
+		params.Outputs = task.out[:1]
+		params.ImplicitOutputs = task.out[1:]
+	} else {
+		// a plain genrule with multiple `out:` entries relies on Ninja's built-in $out
+		// expanding to every declared output, space separated, so all of them must stay in
+		// Outputs.
+		params.Outputs = task.out
+	}
+
+	if task.depFile != nil {
+		params.Depfile = task.depFile
+	}
+
+	ctx.ModuleBuild(pctx, params)
+
+	for i, outputFile := range task.out {
+		g.outputDeps = append(g.outputDeps, outputFile)
+		if i >= len(task.isHeader) || !task.isHeader[i] {
+			g.outputFiles = append(g.outputFiles, outputFile)
+		}
 	}
 }
 
@@ -202,60 +457,201 @@ func generatorFactory(tasks taskFunc, props ...interface{}) (blueprint.Module, [
 		tasks: tasks,
 	}
 
+	if len(props) > 0 {
+		module.extraProperties = props[0]
+	}
+
 	props = append(props, &module.properties)
 
 	return android.InitAndroidModule(module, props...)
 }
 
+// GenRuleDefaults holds properties that can be shared across multiple genrule/gensrcs
+// modules via their `defaults` property, but does not itself generate any build actions.
+//
+// genrule_defaults does not support its own `defaults` property: a genrule_defaults that lists
+// another genrule_defaults in `defaults` is not merged into it, since defaultsMutator only
+// applies a genrule_defaults module's properties to genrule/gensrcs modules that depend on it
+// directly.
+type GenRuleDefaults struct {
+	android.ModuleBase
+
+	properties        generatorProperties
+	genRuleProperties genRuleProperties
+	genSrcsProperties genSrcsProperties
+}
+
+func (d *GenRuleDefaults) GenerateAndroidBuildActions(ctx android.ModuleContext) {
+	if len(d.properties.Defaults) > 0 {
+		ctx.ModuleErrorf("genrule_defaults does not support its own `defaults` property")
+	}
+}
+
+func DefaultsFactory() (blueprint.Module, []interface{}) {
+	module := &GenRuleDefaults{}
+
+	return android.InitAndroidModule(module, &module.properties, &module.genRuleProperties, &module.genSrcsProperties)
+}
+
+// defaultsDepsMutator adds a dependency edge from a genrule/gensrcs module to each
+// genrule_defaults module named in its own `defaults` property.  It runs in PreArchMutators,
+// ahead of the Deps phase that invokes generator.DepsMutator, so that defaultsMutator (also
+// registered in PreArchMutators, immediately after) has already merged in any defaults-only
+// tools/tool_files/srcs by the time DepsMutator adds dependency edges for them.
+func defaultsDepsMutator(ctx android.BottomUpMutatorContext) {
+	g, ok := ctx.Module().(*generator)
+	if !ok || len(g.properties.Defaults) == 0 {
+		return
+	}
+
+	ctx.AddDependency(ctx.Module(), nil, g.properties.Defaults...)
+}
+
+// defaultsMutator merges the properties of each module's `defaults` dependencies into its
+// own properties, so that GenerateAndroidBuildActions sees the fully resolved set.  The merge
+// uses proptools.AppendProperties: list properties and string properties such as cmd are
+// appended after the module's own values, and a bool property ends up true if either the
+// module or a defaults module sets it.
+func defaultsMutator(ctx android.TopDownMutatorContext) {
+	g, ok := ctx.Module().(*generator)
+	if !ok || len(g.properties.Defaults) == 0 {
+		return
+	}
+
+	ctx.VisitDirectDeps(func(module blueprint.Module) {
+		defaults, ok := module.(*GenRuleDefaults)
+		if !ok {
+			return
+		}
+
+		if err := proptools.AppendProperties(&g.properties, &defaults.properties, nil); err != nil {
+			ctx.ModuleErrorf("failed to apply defaults: %s", err)
+		}
+
+		switch extra := g.extraProperties.(type) {
+		case *genRuleProperties:
+			if err := proptools.AppendProperties(extra, &defaults.genRuleProperties, nil); err != nil {
+				ctx.ModuleErrorf("failed to apply defaults: %s", err)
+			}
+		case *genSrcsProperties:
+			if err := proptools.AppendProperties(extra, &defaults.genSrcsProperties, nil); err != nil {
+				ctx.ModuleErrorf("failed to apply defaults: %s", err)
+			}
+		}
+	})
+}
+
 func GenSrcsFactory() (blueprint.Module, []interface{}) {
 	properties := &genSrcsProperties{}
 
-	tasks := func(ctx android.ModuleContext) []generateTask {
-		srcFiles := ctx.ExpandSources(properties.Srcs, nil)
+	tasks := func(ctx android.ModuleContext, g *generatorProperties, srcFiles android.Paths) ([]generateTask, android.Paths) {
+		if properties.Output_extension != "" && len(properties.Output_extensions) > 0 {
+			ctx.PropertyErrorf("output_extensions", "cannot be used with output_extension")
+			return nil, nil
+		}
+
+		exportIncludeDirs := exportedIncludeDirs(ctx, properties.Export_include_dirs)
+
 		tasks := make([]generateTask, 0, len(srcFiles))
 		for _, in := range srcFiles {
-			tasks = append(tasks, generateTask{
-				in:  android.Paths{in},
-				out: android.WritablePaths{android.GenPathWithExt(ctx, "", in, properties.Output_extension)},
-			})
+			var outs android.WritablePaths
+			if len(properties.Output_extensions) > 0 {
+				for _, ext := range properties.Output_extensions {
+					outs = append(outs, android.GenPathWithExt(ctx, "", in, ext))
+				}
+			} else {
+				outs = android.WritablePaths{android.GenPathWithExt(ctx, "", in, properties.Output_extension)}
+			}
+
+			task := generateTask{
+				in:          android.Paths{in},
+				out:         outs,
+				isHeader:    classifyHeaders(outs, exportIncludeDirs),
+				multiOutput: len(properties.Output_extensions) > 0,
+			}
+			if g.Depfile {
+				task.depFile = android.GenPathWithExt(ctx, "", in, "d")
+			}
+			tasks = append(tasks, task)
 		}
-		return tasks
+		return tasks, exportIncludeDirs
 	}
 
 	return generatorFactory(tasks, properties)
 }
 
 type genSrcsProperties struct {
-	// list of input files
-	Srcs []string
-
 	// extension that will be substituted for each output file
 	Output_extension string
+
+	// extensions that will be substituted for each output file when a single invocation of
+	// `cmd` produces more than one output per input, for example a flex/bison or protoc pair
+	// of a header and a source file; mutually exclusive with output_extension
+	Output_extensions []string
+
+	// list of directories, relative to this module's gen directory, whose outputs are
+	// treated as headers rather than sources, and exported to modules that depend on this one
+	Export_include_dirs []string
 }
 
 func GenRuleFactory() (blueprint.Module, []interface{}) {
 	properties := &genRuleProperties{}
 
-	tasks := func(ctx android.ModuleContext) []generateTask {
+	tasks := func(ctx android.ModuleContext, g *generatorProperties, srcFiles android.Paths) ([]generateTask, android.Paths) {
 		outs := make(android.WritablePaths, len(properties.Out))
 		for i, out := range properties.Out {
 			outs[i] = android.PathForModuleGen(ctx, out)
 		}
-		return []generateTask{
-			{
-				in:  ctx.ExpandSources(properties.Srcs, nil),
-				out: outs,
-			},
+
+		exportIncludeDirs := exportedIncludeDirs(ctx, properties.Export_include_dirs)
+
+		task := generateTask{
+			in:       srcFiles,
+			out:      outs,
+			isHeader: classifyHeaders(outs, exportIncludeDirs),
+		}
+		if g.Depfile {
+			task.depFile = android.PathForModuleGen(ctx, "depfile")
 		}
+		return []generateTask{task}, exportIncludeDirs
 	}
 
 	return generatorFactory(tasks, properties)
 }
 
-type genRuleProperties struct {
-	// list of input files
-	Srcs []string
+// exportedIncludeDirs resolves each module-gen-relative directory in dirs to its full path.
+func exportedIncludeDirs(ctx android.ModuleContext, dirs []string) android.Paths {
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	paths := make(android.Paths, len(dirs))
+	for i, dir := range dirs {
+		paths[i] = android.PathForModuleGen(ctx, dir)
+	}
+	return paths
+}
 
+// classifyHeaders reports, for each output in outs, whether it falls under one of
+// exportIncludeDirs and should therefore be treated as a header rather than a source.
+func classifyHeaders(outs android.WritablePaths, exportIncludeDirs android.Paths) []bool {
+	isHeader := make([]bool, len(outs))
+	for i, out := range outs {
+		for _, dir := range exportIncludeDirs {
+			if strings.HasPrefix(out.String(), dir.String()+"/") {
+				isHeader[i] = true
+				break
+			}
+		}
+	}
+	return isHeader
+}
+
+type genRuleProperties struct {
 	// names of the output files that will be generated
 	Out []string
+
+	// list of directories, relative to this module's gen directory, whose outputs are
+	// treated as headers rather than sources, and exported to modules that depend on this one
+	Export_include_dirs []string
 }
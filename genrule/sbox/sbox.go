@@ -0,0 +1,164 @@
+// Copyright 2016 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sbox runs a genrule command inside a restricted sandbox, so that a build rule that forgets
+// to declare one of its inputs fails immediately instead of producing an incremental build
+// that is only flaky.
+//
+// It creates a scratch root inside a fresh mount namespace, bind-mounts in only the caller's
+// declared inputs (srcs, tools) and its output directory, and then execs the real command with
+// PATH cleared to just the tool directories.  A command that reads a path it did not declare
+// fails instead of silently succeeding.  Declared inputs are read-only; anything the command
+// writes outside its output directory lands in the scratch root (which is also its HOME and
+// TMPDIR) and is discarded when sbox exits.
+//
+// On a host without CAP_SYS_ADMIN the mount namespace and chroot are unavailable; sbox falls
+// back to symlinking the declared inputs into the scratch root and running the command unchrooted,
+// so builds still work there, just without the missing-dependency enforcement.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+var (
+	sandboxRoot = flag.String("sandbox-dir", "", "scratch directory to build the sandbox root under")
+	outputRoot  = flag.String("output-root", "", "directory the command is allowed to write to")
+	command     = flag.String("c", "", "command to run inside the sandbox")
+	inputs      pathList
+	tools       pathList
+)
+
+func init() {
+	flag.Var(&inputs, "input", "a declared input file or directory visible inside the sandbox; may be repeated")
+	flag.Var(&tools, "tool", "a declared tool whose directory is added to PATH inside the sandbox; may be repeated")
+}
+
+func main() {
+	flag.Parse()
+
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "sbox: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if *command == "" {
+		return fmt.Errorf("-c is required")
+	}
+	if *outputRoot == "" {
+		return fmt.Errorf("--output-root is required")
+	}
+
+	if err := os.MkdirAll(*sandboxRoot, 0755); err != nil {
+		return fmt.Errorf("failed to create %q: %w", *sandboxRoot, err)
+	}
+
+	root, err := os.MkdirTemp(*sandboxRoot, "sbox")
+	if err != nil {
+		return fmt.Errorf("failed to create sandbox root: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(root); err != nil {
+			fmt.Fprintf(os.Stderr, "sbox: failed to clean up %q: %s\n", root, err)
+		}
+	}()
+
+	visible := append(append(pathList{}, inputs...), tools...)
+	visible = append(visible, *outputRoot)
+
+	chrooted, err := mountSandbox(root, visible, *outputRoot)
+	if err != nil {
+		return err
+	}
+
+	// once chrooted, root itself is the new "/", so the old absolute host path no longer
+	// resolves; when the sandbox falls back to symlinks instead (see symlinkSandbox), root is
+	// still a real, reachable host path.
+	home := root
+	if chrooted {
+		home = "/"
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", *command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = []string{
+		"PATH=" + toolPath(tools),
+		"HOME=" + home,
+		"TMPDIR=" + home,
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
+// symlinkSandbox is the fallback mountSandbox implementations use when they cannot get or use a
+// private mount namespace (for example an unprivileged build machine or container that lacks
+// CAP_SYS_ADMIN): it symlinks each declared path into root instead of bind-mounting it, so the
+// command still finds every input at its normal absolute path. This keeps genrule commands
+// working in that environment, but unlike the mount-namespace path it does not hide anything
+// outside of visible, so a missing dependency declaration will not be caught.
+func symlinkSandbox(root string, visible []string) error {
+	for _, p := range visible {
+		if p == "" {
+			continue
+		}
+		p = filepath.Clean(p)
+		target := filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(p, target); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("failed to symlink %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// toolPath returns a PATH listing only the directories that contain a declared tool, so that a
+// command cannot accidentally pick up a host binary that was not listed in `tools`/`tool_files`.
+func toolPath(tools []string) string {
+	seen := map[string]bool{}
+	var dirs []string
+	for _, t := range tools {
+		dir := filepath.Dir(t)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return strings.Join(dirs, ":")
+}
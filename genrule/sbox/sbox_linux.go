@@ -0,0 +1,91 @@
+// Copyright 2016 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// mountSandbox bind-mounts each path in visible onto itself under root, after mounting an
+// empty tmpfs over root so that no other path in the real filesystem is reachable, then chroots
+// into it.  outputRoot is mounted read-write; every other path is mounted read-only.
+//
+// Unshare, the bind mounts, and the chroot all require CAP_SYS_ADMIN, which most unprivileged
+// build machines and CI containers do not have. When any of those steps fail, mountSandbox falls
+// back to symlinkSandbox and reports that it did not chroot, so the caller can still run the
+// command, without the guarantee that an undeclared dependency will fail the build.
+func mountSandbox(root string, visible []string, outputRoot string) (bool, error) {
+	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+		return false, symlinkSandbox(root, visible)
+	}
+
+	if err := syscall.Mount("tmpfs", root, "tmpfs", 0, ""); err != nil {
+		return false, symlinkSandbox(root, visible)
+	}
+
+	for i, p := range visible {
+		if p == "" {
+			continue
+		}
+
+		p = filepath.Clean(p)
+		target := filepath.Join(root, p)
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return false, fmt.Errorf("failed to stat %q: %w", p, err)
+		}
+
+		if info.IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return false, err
+			}
+		} else {
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return false, err
+			}
+			if f, err := os.OpenFile(target, os.O_CREATE, 0644); err != nil {
+				return false, err
+			} else {
+				f.Close()
+			}
+		}
+
+		if err := syscall.Mount(p, target, "", syscall.MS_BIND, ""); err != nil {
+			// everything before visible[i] is already bind-mounted; only the rest still
+			// needs a fallback.
+			return false, symlinkSandbox(root, visible[i:])
+		}
+		if p != outputRoot {
+			// the kernel ignores MS_RDONLY on the initial bind mount; it takes a remount to
+			// make the bind mount read-only.
+			flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+			if err := syscall.Mount("", target, "", flags, ""); err != nil {
+				return false, fmt.Errorf("failed to make %q read-only: %w", p, err)
+			}
+		}
+	}
+
+	if err := syscall.Chroot(root); err != nil {
+		// every path in visible already has a real bind mount under root; there is nothing
+		// left for symlinkSandbox to do.
+		return false, nil
+	}
+
+	return true, os.Chdir("/")
+}
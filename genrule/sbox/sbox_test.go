@@ -0,0 +1,105 @@
+// Copyright 2016 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestToolPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools []string
+		want  string
+	}{
+		{
+			name:  "empty",
+			tools: nil,
+			want:  "",
+		},
+		{
+			name:  "single tool",
+			tools: []string{"/a/bin/tool"},
+			want:  "/a/bin",
+		},
+		{
+			name:  "dedups tools in the same directory",
+			tools: []string{"/a/bin/tool1", "/a/bin/tool2"},
+			want:  "/a/bin",
+		},
+		{
+			name:  "preserves order of distinct directories",
+			tools: []string{"/b/bin/tool", "/a/bin/tool"},
+			want:  "/b/bin:/a/bin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toolPath(tt.tools); got != tt.want {
+				t.Errorf("toolPath(%v) = %q, want %q", tt.tools, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymlinkSandbox(t *testing.T) {
+	root := t.TempDir()
+
+	srcDir := t.TempDir()
+	srcFile := filepath.Join(srcDir, "input.txt")
+	if err := os.WriteFile(srcFile, []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to create %q: %s", srcFile, err)
+	}
+
+	visible := []string{"", srcFile, srcDir}
+	if err := symlinkSandbox(root, visible); err != nil {
+		t.Fatalf("symlinkSandbox() returned error: %s", err)
+	}
+
+	target := filepath.Join(root, srcFile)
+	link, err := os.Readlink(target)
+	if err != nil {
+		t.Fatalf("expected %q to be a symlink: %s", target, err)
+	}
+	if link != srcFile {
+		t.Errorf("symlink %q points to %q, want %q", target, link, srcFile)
+	}
+
+	contents, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("failed to read through symlink %q: %s", target, err)
+	}
+	if string(contents) != "hello" {
+		t.Errorf("read %q through symlink, want %q", contents, "hello")
+	}
+}
+
+func TestSymlinkSandboxIgnoresExisting(t *testing.T) {
+	root := t.TempDir()
+	srcFile := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(srcFile, []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to create %q: %s", srcFile, err)
+	}
+
+	if err := symlinkSandbox(root, []string{srcFile}); err != nil {
+		t.Fatalf("first symlinkSandbox() returned error: %s", err)
+	}
+	if err := symlinkSandbox(root, []string{srcFile}); err != nil {
+		t.Fatalf("second symlinkSandbox() over the same path returned error: %s", err)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2016 Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+// mountSandbox falls back to symlinkSandbox on hosts that do not support Linux mount namespaces;
+// the command still runs with PATH cleared to the declared tools, but filesystem isolation is
+// unavailable.
+func mountSandbox(root string, visible []string, outputRoot string) (bool, error) {
+	return false, symlinkSandbox(root, visible)
+}